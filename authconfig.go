@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dockerAuthConfig : containts a single registry entry of a Docker/Podman config file
+type dockerAuthConfig struct {
+	Auth string `json:"auth"`
+}
+
+// dockerConfigFile : containts the subset of Docker/Podman config.json we care about
+type dockerConfigFile struct {
+	Auths map[string]dockerAuthConfig `json:"auths"`
+	CredsStore string `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// canonicalRegistryHost maps the various hostnames Docker Hub is known under to a single key
+func canonicalRegistryHost(host string) string {
+	switch host {
+	case dockerRegistryDomain, "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	default:
+		return host
+	}
+}
+
+// credsStoreKey maps authHost to the server URL credsStore credential helpers are
+// actually invoked with, which for Docker Hub is "https://index.docker.io/v1/" rather
+// than the bare "docker.io" host used everywhere else.
+func credsStoreKey(authHost string) string {
+	if authHost == "docker.io" {
+		return "https://index.docker.io/v1/"
+	}
+
+	return authHost
+}
+
+// normalizeAuthKey strips the scheme/path Docker stores config.json keys with
+// (e.g. "https://index.docker.io/v1/") down to a bare, canonicalized host
+func normalizeAuthKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key = strings.TrimSuffix(key, "/")
+	key = strings.TrimSuffix(key, "/v1")
+
+	return canonicalRegistryHost(key)
+}
+
+// authConfigPaths lists the config files to look for credentials in, in priority order
+func authConfigPaths() []string {
+	var paths []string
+
+	if dockerConfigDir := os.Getenv("DOCKER_CONFIG"); dockerConfigDir != "" {
+		paths = append(paths, filepath.Join(dockerConfigDir, "config.json"))
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+		paths = append(paths, filepath.Join(home, ".config", "containers", "auth.json"))
+	}
+
+	return paths
+}
+
+// credHelperGet invokes `docker-credential-<helper> get` per the credential helper protocol
+func credHelperGet(helper, serverURL string) (string, string, error) {
+	helperBin := "docker-credential-" + helper
+
+	cmd := exec.Command(helperBin, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("%s get failed: %v", helperBin, err)
+	}
+
+	var credentials struct {
+		Username string `json:"Username"`
+		Secret string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &credentials); err != nil {
+		return "", "", fmt.Errorf("Unmarshal %s response failed: %v", helperBin, err)
+	}
+
+	return credentials.Username, credentials.Secret, nil
+}
+
+// resolveRegistryCredentials looks up credentials for authHost in the Docker/Podman config
+// files, decoding inline "auths" entries and falling back to credsStore/credHelpers binaries.
+// It returns an empty username/password, without error, if no entry is found anywhere.
+func resolveRegistryCredentials(authHost string) (string, string, error) {
+	for _, path := range authConfigPaths() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var config dockerConfigFile
+		if err := json.Unmarshal(data, &config); err != nil {
+			log.Debugf("Cannot parse %s: %v", path, err)
+			continue
+		}
+
+		for key, entry := range config.Auths {
+			if normalizeAuthKey(key) != authHost || entry.Auth == "" {
+				continue
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("decode auth for %s in %s failed: %v", key, path, err)
+			}
+
+			user, pass, found := strings.Cut(string(decoded), ":")
+			if found {
+				return user, pass, nil
+			}
+		}
+
+		for key, helper := range config.CredHelpers {
+			if normalizeAuthKey(key) != authHost || helper == "" {
+				continue
+			}
+
+			if user, pass, err := credHelperGet(helper, key); err == nil {
+				return user, pass, nil
+			}
+		}
+
+		if config.CredsStore != "" {
+			if user, pass, err := credHelperGet(config.CredsStore, credsStoreKey(authHost)); err == nil {
+				return user, pass, nil
+			}
+		}
+	}
+
+	return "", "", nil
+}
@@ -1,5 +1,7 @@
 // Compatible with container registries supporting Image Manifest Version 2, Schema 1
 // https://docs.docker.com/registry/spec/manifest-v2-1/
+// and Image Manifest Version 2, Schema 2 / OCI Image Manifest
+// https://docs.docker.com/registry/spec/manifest-v2-2/
 
 package main
 
@@ -10,7 +12,12 @@ import (
 	"time"
 	"sort"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 	log "github.com/sirupsen/logrus"
@@ -18,12 +25,30 @@ import (
 )
 
 const (
-	ver string = "0.15"
+	ver string = "0.16"
 	logDateLayout string = "2006-01-02 15:04:05"
 	httpTimeout int = 10
 	dockerRegistryDomain = "registry.hub.docker.com"
+
+	mediaTypeManifestV1 = "application/vnd.docker.distribution.manifest.v1+json"
+	mediaTypeManifestV2 = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+
+	// anonymousCredential is the default --username/--password value, meaning "no
+	// credentials were configured" rather than a literal account named "anonymous".
+	anonymousCredential = "anonymous"
 )
 
+var manifestAcceptHeader = strings.Join([]string{
+	mediaTypeManifestV2,
+	mediaTypeOCIManifest,
+	mediaTypeManifestList,
+	mediaTypeOCIIndex,
+	mediaTypeManifestV1,
+}, ", ")
+
 var (
 	redisPassword = kingpin.Flag("redis-password", "Redis password.").Default("").String()
 	redisKeyTTL = kingpin.Flag("redis-key-ttl", "Redis key TTL in seconds.").Default("604800").Int()
@@ -38,7 +63,23 @@ var (
 	threads = kingpin.Flag("threads", "Number of threads for accessing registry.").Default("30").Int()
 	jsonOutput = kingpin.Flag("json-output", "Generate output in JSON format.").Short('j').Bool()
 	retries = kingpin.Flag("retries", "Number of retries to access container registry.").Default("10").Int()
-	image = kingpin.Arg("image", "Image name.").Required().String()
+	platform = kingpin.Flag("platform", "Platform to select when manifest is a manifest list / OCI index (os/arch).").Default("linux/amd64").String()
+	tagsPageSize = kingpin.Flag("tags-page-size", "Number of tags to request per page when listing tags.").Default("1000").Int()
+	semverEnabled = kingpin.Flag("semver", "Select the newest tag by semantic version instead of by creation date.").Bool()
+	semverConstraint = kingpin.Flag("semver-constraint", "Semver constraint candidate tags must satisfy, e.g. \"^1.2\" or \">=1.0, <2.0\".").String()
+	semverPrefix = kingpin.Flag("semver-prefix", "Prefix to strip from a tag before parsing it as a semver.").Default("v").String()
+	includeRegex = kingpin.Flag("include-regex", "Only consider tags matching this regular expression.").String()
+	excludeRegex = kingpin.Flag("exclude-regex", "Exclude tags matching this regular expression.").String()
+	failOnError = kingpin.Flag("fail-on-error", "Abort the whole run if any single tag cannot be resolved (previous default behavior).").Bool()
+
+	resolveCmd = kingpin.Command("resolve", "Resolve the newest tag for an image (default).").Default()
+	image = resolveCmd.Arg("image", "Image name.").Required().String()
+
+	serveCmd = kingpin.Command("serve", "Run as a long-lived HTTP service exposing a JSON API.")
+	serveListenAddress = serveCmd.Flag("listen-address", "Address for the HTTP service to listen on.").Default(":8080").String()
+	serveCacheSize = serveCmd.Flag("cache-size", "Maximum number of entries in the in-process (L1) cache.").Default("1000").Int()
+	serveCacheTTL = serveCmd.Flag("cache-ttl", "TTL in seconds for entries in the in-process (L1) cache.").Default("300").Int()
+	serveRegistryConcurrency = serveCmd.Flag("registry-concurrency", "Maximum concurrent in-flight requests per registry host (separate from --threads).").Default("10").Int()
 )
 
 // TagList : containts image tag list data
@@ -47,7 +88,7 @@ type TagList struct {
 	Tags []string `json:"tags"`
 }
 
-// TagManifest : containts image tag manifest data
+// TagManifest : containts image tag manifest data (Schema 1)
 type TagManifest struct {
 	Name string `json:"name"`
 	SchemaVersion int `json:"schemaVersion"`
@@ -61,19 +102,71 @@ type ManifestHistoryItem struct {
 	Created string `json:"created"`
 }
 
+// ManifestEnvelope : contains just enough of a manifest to tell schema/kind apart
+type ManifestEnvelope struct {
+	MediaType string `json:"mediaType"`
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// ManifestV2 : containts Schema 2 / OCI image manifest data
+type ManifestV2 struct {
+	MediaType string `json:"mediaType"`
+	SchemaVersion int `json:"schemaVersion"`
+	Config struct {
+		MediaType string `json:"mediaType"`
+		Digest string `json:"digest"`
+		Size int64 `json:"size"`
+	} `json:"config"`
+}
+
+// ManifestList : containts Schema 2 manifest list / OCI image index data
+type ManifestList struct {
+	MediaType string `json:"mediaType"`
+	SchemaVersion int `json:"schemaVersion"`
+	Manifests []struct {
+		MediaType string `json:"mediaType"`
+		Digest string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// ConfigBlob : containts the fields of the image config blob we care about
+type ConfigBlob struct {
+	Created string `json:"created"`
+}
+
 // ImageParts : containts image parts
 type ImageParts struct {
 	host string
 	path string
+	authHost string
 }
 
 // HTTPResponse : containts HTTP response data
 type HTTPResponse struct {
 	body string
+	headers http.Header
 	err error
 	statusCode int
 }
 
+// httpStatusError : a terminal (non-retryable) HTTP response, e.g. 403/404, as opposed
+// to a transient failure (5xx, timeout) that retryGetRequest already retries internally.
+// getNewestTag type-asserts this to abort on a 401 (the credentials themselves are
+// rejected, so every tag would fail identically), while a 403/404 on a single tag is
+// treated like an ordinary per-tag failure (deleted/forbidden tag) and merely skipped.
+type httpStatusError struct {
+	url string
+	statusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: HTTP response code: %d", e.url, e.statusCode)
+}
+
 // ImageTag : containts image tags create time
 type ImageTag struct {
 	tag string
@@ -86,10 +179,24 @@ type Output struct {
 	Tag string `json:"tag"`
 	Image string `json:"image"`
 	ImageWithTag string `json:"imageWithTag"`
+	Skipped []SkippedTag `json:"skipped,omitempty"`
+}
+
+// SkippedTag : containts a tag that was excluded from selection because it could not be resolved
+type SkippedTag struct {
+	Tag string `json:"tag"`
+	Reason string `json:"reason"`
 }
 
+var (
+	bearerTokenCache = make(map[string]string)
+	bearerTokenMutex sync.Mutex
+	wwwAuthenticateRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
 func parseImageName(imageName string) (ImageParts, error) {
-	var imageParts ImageParts 
+	var imageParts ImageParts
 
 	parts := strings.Split(imageName, "/")
 	// Docker Hub official images ("library" prefix)
@@ -108,10 +215,99 @@ func parseImageName(imageName string) (ImageParts, error) {
 		}
 	}
 
+	imageParts.authHost = canonicalRegistryHost(imageParts.host)
+
 	return imageParts, nil
 }
 
-func httpGet(url, basicAuthUser, basicAuthPassword string, response chan<- HTTPResponse) {
+// parsePlatform splits a "os/arch" string into its components, falling back to linux/amd64
+func parsePlatform(platformStr string) (string, string) {
+	parts := strings.SplitN(platformStr, "/", 2)
+	if len(parts) != 2 {
+		return "linux", "amd64"
+	}
+
+	return parts[0], parts[1]
+}
+
+// parseWwwAuthenticate extracts the key="value" pairs out of a Bearer Www-Authenticate header
+func parseWwwAuthenticate(header string) map[string]string {
+	params := make(map[string]string)
+
+	matches := wwwAuthenticateRegexp.FindAllStringSubmatch(header, -1)
+	for _, match := range matches {
+		params[match[1]] = match[2]
+	}
+
+	return params
+}
+
+// getBearerToken performs the v2 Bearer token exchange against realm, caching the result
+// for the process lifetime keyed by realm+service+scope.
+func getBearerToken(realm, service, scope, basicAuthUser, basicAuthPassword string) (string, error) {
+	cacheKey := realm + "|" + service + "|" + scope
+
+	bearerTokenMutex.Lock()
+	if token, ok := bearerTokenCache[cacheKey]; ok {
+		bearerTokenMutex.Unlock()
+		return token, nil
+	}
+	bearerTokenMutex.Unlock()
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+
+	query := tokenURL.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	body, _, err := retryGetRequest(tokenURL.String(), basicAuthUser, basicAuthPassword, "")
+	if err != nil {
+		return "", err
+	}
+
+	var tokenResponse struct {
+		Token string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal([]byte(body), &tokenResponse); err != nil {
+		return "", fmt.Errorf("Unmarshal token response failed: %v", err)
+	}
+
+	token := tokenResponse.Token
+	if token == "" {
+		token = tokenResponse.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("%s: token exchange returned an empty token", tokenURL.String())
+	}
+
+	bearerTokenMutex.Lock()
+	bearerTokenCache[cacheKey] = token
+	bearerTokenMutex.Unlock()
+
+	return token, nil
+}
+
+// hasCredentials reports whether user/password are real credentials rather than the
+// anonymousCredential sentinel, which must never be sent as Basic auth: token servers
+// that validate it (auth.docker.io, ghcr.io, quay.io) reject "anonymous:anonymous" outright.
+func hasCredentials(user, password string) bool {
+	if user == anonymousCredential && password == anonymousCredential {
+		return false
+	}
+
+	return user != "" && password != ""
+}
+
+func httpGet(url, basicAuthUser, basicAuthPassword, accept, bearerToken string, response chan<- HTTPResponse) {
 	var msg HTTPResponse
 
 	client := &http.Client{}
@@ -122,7 +318,13 @@ func httpGet(url, basicAuthUser, basicAuthPassword string, response chan<- HTTPR
 		return
 	}
 
-	if basicAuthUser != "" && basicAuthPassword != "" {
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	} else if hasCredentials(basicAuthUser, basicAuthPassword) {
 		req.SetBasicAuth(basicAuthUser, basicAuthPassword)
 	}
 
@@ -134,6 +336,7 @@ func httpGet(url, basicAuthUser, basicAuthPassword string, response chan<- HTTPR
 	}
 
 	msg.statusCode = resp.StatusCode
+	msg.headers = resp.Header
 
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
@@ -149,9 +352,14 @@ func httpGet(url, basicAuthUser, basicAuthPassword string, response chan<- HTTPR
 	return
 }
 
-func retryGetRequest(url, username, password string) (string, error) {
+// retryGetRequest issues a GET request, retrying on 5xx/timeout and transparently
+// negotiating a Bearer token on a 401 Www-Authenticate challenge. It returns the
+// response headers of the final, successful request alongside the body.
+func retryGetRequest(url, username, password, accept string) (string, http.Header, error) {
 	var responseError error
 	var body string
+	var headers http.Header
+	var bearerToken string
 
 	response := make(chan HTTPResponse)
 	Loop:
@@ -160,7 +368,7 @@ func retryGetRequest(url, username, password string) (string, error) {
 				log.Debugf("Retrying (%d) request %s", retry, url)
 				time.Sleep(time.Second * time.Duration(retry))
 			}
-			go httpGet(url, username, password, response)
+			go httpGet(url, username, password, accept, bearerToken, response)
 
 			select {
 			case msg := <-response:
@@ -168,12 +376,27 @@ func retryGetRequest(url, username, password string) (string, error) {
 					if msg.statusCode == 200 {
 						responseError = nil
 						body = msg.body
+						headers = msg.headers
+						break Loop
+					} else if msg.statusCode == 401 && bearerToken == "" {
+						challenge := msg.headers.Get("Www-Authenticate")
+						params := parseWwwAuthenticate(challenge)
+						if strings.HasPrefix(strings.ToLower(challenge), "bearer") && params["realm"] != "" {
+							token, err := getBearerToken(params["realm"], params["service"], params["scope"], username, password)
+							if err != nil {
+								responseError = fmt.Errorf("%s: bearer token exchange failed: %v", url, err)
+								break Loop
+							}
+							bearerToken = token
+							continue Loop
+						}
+						responseError = &httpStatusError{url: url, statusCode: msg.statusCode}
 						break Loop
 					} else if msg.statusCode >= 500 {
 						responseError = fmt.Errorf("%s: HTTP response code (%d retries): %d", url, retry, msg.statusCode)
 						continue Loop
 					} else {
-						responseError = fmt.Errorf("%s: HTTP response code: %d", url, msg.statusCode)
+						responseError = &httpStatusError{url: url, statusCode: msg.statusCode}
 						break Loop
 					}
 				} else {
@@ -187,10 +410,30 @@ func retryGetRequest(url, username, password string) (string, error) {
 		}
 
 	if responseError != nil {
-		return "", responseError
+		return "", nil, responseError
 	}
 
-	return body, nil
+	return body, headers, nil
+}
+
+// nextTagsPage extracts the next page URL from a paginated /tags/list response,
+// per RFC 5988: Link: <.../tags/list?n=100&last=foo>; rel="next"
+func nextTagsPage(headers http.Header, host string) (string, bool) {
+	if headers == nil {
+		return "", false
+	}
+
+	match := linkNextRegexp.FindStringSubmatch(headers.Get("Link"))
+	if match == nil {
+		return "", false
+	}
+
+	next := match[1]
+	if strings.HasPrefix(next, "/") {
+		next = "https://" + host + next
+	}
+
+	return next, true
 }
 
 func getTagsList(image, username, password string) (TagList, error) {
@@ -202,39 +445,96 @@ func getTagsList(image, username, password string) (TagList, error) {
 		return tagList, err
 	}
 
-	url := "https://" + imageParts.host + "/v2/" + imageParts.path + "/tags/list"
-	body, err := retryGetRequest(url, username, password)
+	url := "https://" + imageParts.host + "/v2/" + imageParts.path + "/tags/list?n=" + strconv.Itoa(*tagsPageSize)
+
+	for {
+		body, headers, err := retryGetRequest(url, username, password, "")
+		if err != nil {
+			return tagList, err
+		}
+
+		var page TagList
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return tagList, fmt.Errorf("Unmarshal body failed: %v", err)
+		}
+
+		tagList.Name = page.Name
+		tagList.Tags = append(tagList.Tags, page.Tags...)
+
+		next, ok := nextTagsPage(headers, imageParts.host)
+		if !ok {
+			break
+		}
+		url = next
+	}
+
+	return tagList, nil
+}
+
+// getTagsListLimited wraps getTagsList with the per-host registry limiter, if any, held
+// for the whole (possibly paginated) listing, so it bounds list-request concurrency the
+// same way processTag bounds per-tag manifest fetches.
+func getTagsListLimited(image, username, password string, limiter *registryLimiter, host string) (TagList, error) {
+	if limiter != nil {
+		release := limiter.acquire(host)
+		defer release()
+	}
+
+	return getTagsList(image, username, password)
+}
+
+// fetchManifest retrieves the raw manifest (or manifest list) body, and its response
+// headers, for a tag or digest reference
+func fetchManifest(image, reference, username, password string) (string, http.Header, error) {
+	log.Debugf("Getting container registry manifest for reference %s", reference)
+
+	imageParts, err := parseImageName(image)
 	if err != nil {
-		return tagList, err
+		return "", nil, err
 	}
 
-	if err := json.Unmarshal([]byte(body), &tagList); err != nil {
-		return tagList, fmt.Errorf("Unmarshal body failed: %v", err)
+	url := "https://" + imageParts.host + "/v2/" + imageParts.path + "/manifests/" + reference
+	body, headers, err := retryGetRequest(url, username, password, manifestAcceptHeader)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return tagList, nil
+	return body, headers, nil
 }
 
-func getTagManifest(image, tag, username, password string) (TagManifest, error) {
-	var tagManifest TagManifest
-	log.Debugf("Getting container registry manifest for tag %s", tag)
+// fetchConfigBlob retrieves and parses the image config blob referenced by a Schema 2 / OCI manifest
+func fetchConfigBlob(image, digest, username, password string) (ConfigBlob, error) {
+	var configBlob ConfigBlob
 
 	imageParts, err := parseImageName(image)
 	if err != nil {
-		return tagManifest, err
+		return configBlob, err
 	}
 
-	url := "https://" + imageParts.host + "/v2/" + imageParts.path + "/manifests/" + tag
-	body, err := retryGetRequest(url, username, password)
+	url := "https://" + imageParts.host + "/v2/" + imageParts.path + "/blobs/" + digest
+	body, _, err := retryGetRequest(url, username, password, "")
 	if err != nil {
-		return tagManifest, err
+		return configBlob, err
 	}
 
-	if err := json.Unmarshal([]byte(body), &tagManifest); err != nil {
-		return tagManifest, fmt.Errorf("Unmarshal body failed: %v", err)
+	if err := json.Unmarshal([]byte(body), &configBlob); err != nil {
+		return configBlob, fmt.Errorf("Unmarshal body failed: %v", err)
 	}
 
-	return tagManifest, nil
+	return configBlob, nil
+}
+
+// selectPlatformManifestDigest picks the digest of the child manifest matching *platform
+func selectPlatformManifestDigest(manifestList ManifestList) (string, error) {
+	wantOS, wantArch := parsePlatform(*platform)
+
+	for _, m := range manifestList.Manifests {
+		if m.Platform.OS == wantOS && m.Platform.Architecture == wantArch {
+			return m.Digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("no manifest found for platform %s", *platform)
 }
 
 func getNewestManifestHistoryItem(tagManifest TagManifest) (time.Time, error) {
@@ -262,83 +562,198 @@ func getNewestManifestHistoryItem(tagManifest TagManifest) (time.Time, error) {
 	return createDates[0], nil
 }
 
-func getTagDate(image, tagName, username, password string) (time.Time, error) {
-	manifest, err := getTagManifest(image, tagName, username, password)
+// manifestMediaType determines a manifest's media type from the response's Content-Type
+// header, falling back to the body's own "mediaType" field. OCI manifests/indexes may
+// legitimately omit "mediaType" from the body, so the header must be consulted first.
+func manifestMediaType(headers http.Header, bodyMediaType string) string {
+	if headers != nil {
+		if contentType, _, err := mime.ParseMediaType(headers.Get("Content-Type")); err == nil && contentType != "" {
+			return contentType
+		}
+	}
+
+	return bodyMediaType
+}
+
+// getTagDate resolves the creation date of a tag, following manifest lists/indexes down
+// to a platform-specific manifest, and supporting both Schema 1 and Schema 2 / OCI manifests.
+func getTagDate(image, reference, username, password string) (time.Time, error) {
+	body, headers, err := fetchManifest(image, reference, username, password)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	if manifest.SchemaVersion != 1 {
-		return time.Time{}, fmt.Errorf("Wrong image manifest version, should be Image Manifest Version 2, Schema 1: https://docs.docker.com/registry/spec/manifest-v2-1")
+	var envelope ManifestEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return time.Time{}, fmt.Errorf("Unmarshal body failed: %v", err)
 	}
 
-	date, err := getNewestManifestHistoryItem(manifest)
-	if err != nil {
-		return time.Time{}, err
+	mediaType := manifestMediaType(headers, envelope.MediaType)
+
+	switch mediaType {
+	case mediaTypeManifestList, mediaTypeOCIIndex:
+		var manifestList ManifestList
+		if err := json.Unmarshal([]byte(body), &manifestList); err != nil {
+			return time.Time{}, fmt.Errorf("Unmarshal body failed: %v", err)
+		}
+
+		digest, err := selectPlatformManifestDigest(manifestList)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return getTagDate(image, digest, username, password)
+	case mediaTypeManifestV2, mediaTypeOCIManifest:
+		var manifest ManifestV2
+		if err := json.Unmarshal([]byte(body), &manifest); err != nil {
+			return time.Time{}, fmt.Errorf("Unmarshal body failed: %v", err)
+		}
+
+		configBlob, err := fetchConfigBlob(image, manifest.Config.Digest, username, password)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		date, err := time.Parse(time.RFC3339Nano, configBlob.Created)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return date, nil
+	default:
+		// Fall back to Image Manifest Version 2, Schema 1
+		var manifest TagManifest
+		if err := json.Unmarshal([]byte(body), &manifest); err != nil {
+			return time.Time{}, fmt.Errorf("Unmarshal body failed: %v", err)
+		}
+
+		if manifest.SchemaVersion != 1 {
+			return time.Time{}, fmt.Errorf("Unsupported image manifest, mediaType %q, schemaVersion %d", mediaType, manifest.SchemaVersion)
+		}
+
+		return getNewestManifestHistoryItem(manifest)
 	}
+}
 
-	return date, nil
+// tagJob is a unit of work submitted to a workerPool: resolve the creation date of one
+// tag of image and send the result to results.
+type tagJob struct {
+	image string
+	tagName string
+	username string
+	password string
+	redisClient *redis.Client
+	limiter *registryLimiter
+	host string
+	results chan<- ImageTag
 }
 
-func getTagDateUsingCache(image, username, password string, redisClient *redis.Client, tags <-chan string, results chan<- ImageTag) {
-	for tagName := range tags {
-		var imageTag ImageTag
-		imageTag.tag = tagName
+// workerPool is a fixed-size pool of goroutines processing tagJobs, sized by --threads.
+// The CLI path spins up a pool per run; the "serve" subcommand creates a single pool
+// shared across every HTTP request's worth of work, so --threads bounds total tag
+// resolution concurrency for the life of the process instead of being multiplied by the
+// number of concurrent /newest requests.
+type workerPool struct {
+	jobs chan tagJob
+}
 
-		imageWithTag := image + ":" + tagName
+func newWorkerPool(size int) *workerPool {
+	pool := &workerPool{jobs: make(chan tagJob)}
 
-		if *cache {
-			dateStr, err := redisClient.Get(imageWithTag).Result()
-			if err == redis.Nil {
-				log.Debugf("Image tag %s not in cache, calling container registry", imageWithTag)
+	for w := 1; w <= size; w++ {
+		go pool.run()
+	}
 
-				imageTag.date, err = getTagDate(image, tagName, username, password)
-				if err != nil {
-					imageTag.err = err
-					results <- imageTag
-					continue
-				}
+	return pool
+}
 
-				err = redisClient.Set(imageWithTag, imageTag.date.Format(time.RFC3339Nano), time.Duration(*redisKeyTTL) * time.Second).Err()
-				if err != nil {
-					log.Warnf("Cannot write tag %s to redis: %v", tagName, err)
-				}
-			} else if err != nil {
-				log.Warnf("Cannot connect to redis: %v", err)
-				log.Debugf("Calling container registry for tag %s", imageWithTag)
-
-				imageTag.date, err = getTagDate(image, tagName, username, password)
-				if err != nil {
-					imageTag.err = err
-					results <- imageTag
-					continue
-				}
+func (p *workerPool) run() {
+	for job := range p.jobs {
+		processTag(job.image, job.tagName, job.username, job.password, job.redisClient, job.limiter, job.host, job.results)
+	}
+}
 
-				err = redisClient.Set(imageWithTag, imageTag.date.Format(time.RFC3339Nano), time.Duration(*redisKeyTTL) * time.Second).Err()
-				if err != nil {
-					log.Warnf("Cannot write tag %s to redis: %v", tagName, err)
-				}
-			} else {
-				log.Debugf("Image tag %s present in cache", imageWithTag)
-
-				imageTag.date, err = time.Parse(time.RFC3339Nano, dateStr)
-				if err != nil {
-					imageTag.err = err
-					results <- imageTag
-					continue
-				}
+func (p *workerPool) submit(job tagJob) {
+	p.jobs <- job
+}
+
+// processTag resolves the creation date of a single tag, consulting the Redis cache if
+// enabled, and sends the result to results. If limiter is non-nil, it is acquired for
+// the duration of the actual registry round trip, so it bounds real in-flight requests
+// per host regardless of how many tags are being resolved concurrently.
+func processTag(image, tagName, username, password string, redisClient *redis.Client, limiter *registryLimiter, host string, results chan<- ImageTag) {
+	var imageTag ImageTag
+	imageTag.tag = tagName
+
+	imageWithTag := image + ":" + tagName
+
+	fetchDate := func() (time.Time, error) {
+		if limiter != nil {
+			release := limiter.acquire(host)
+			defer release()
+		}
+		return getTagDate(image, tagName, username, password)
+	}
+
+	if *cache {
+		dateStr, err := redisClient.Get(imageWithTag).Result()
+		if err == redis.Nil {
+			log.Debugf("Image tag %s not in cache, calling container registry", imageWithTag)
+
+			imageTag.date, err = fetchDate()
+			if err != nil {
+				imageTag.err = err
+				results <- imageTag
+				return
+			}
+
+			err = redisClient.Set(imageWithTag, imageTag.date.Format(time.RFC3339Nano), time.Duration(*redisKeyTTL) * time.Second).Err()
+			if err != nil {
+				log.Warnf("Cannot write tag %s to redis: %v", tagName, err)
+			}
+		} else if err != nil {
+			log.Warnf("Cannot connect to redis: %v", err)
+			log.Debugf("Calling container registry for tag %s", imageWithTag)
+
+			imageTag.date, err = fetchDate()
+			if err != nil {
+				imageTag.err = err
+				results <- imageTag
+				return
+			}
+
+			err = redisClient.Set(imageWithTag, imageTag.date.Format(time.RFC3339Nano), time.Duration(*redisKeyTTL) * time.Second).Err()
+			if err != nil {
+				log.Warnf("Cannot write tag %s to redis: %v", tagName, err)
 			}
 		} else {
-			var err error
-			imageTag.date, err = getTagDate(image, tagName, username, password)
+			log.Debugf("Image tag %s present in cache", imageWithTag)
+
+			imageTag.date, err = time.Parse(time.RFC3339Nano, dateStr)
 			if err != nil {
 				imageTag.err = err
 				results <- imageTag
-				continue
+				return
 			}
 		}
+	} else {
+		var err error
+		imageTag.date, err = fetchDate()
+		if err != nil {
+			imageTag.err = err
+			results <- imageTag
+			return
+		}
+	}
+
+	results <- imageTag
+}
 
-		results <- imageTag
+// getTagDateUsingCache loops processTag over tags, used by the CLI path's per-run worker
+// pool (see getNewestTag).
+func getTagDateUsingCache(image, username, password string, redisClient *redis.Client, limiter *registryLimiter, host string, tags <-chan string, results chan<- ImageTag) {
+	for tagName := range tags {
+		processTag(image, tagName, username, password, redisClient, limiter, host, results)
 	}
 }
 
@@ -360,61 +775,127 @@ func selectTagFromConflictingTags(tags []ImageTag) string {
 	return tagList[0]
 }
 
-func getNewestTag(image, username, password string, redisClient *redis.Client) (Output, error) {
+// getNewestTag resolves the newest tag of image. limiter and pool are optional (nil for
+// the CLI path, which resolves a single image per process): when pool is given, per-tag
+// work is submitted to it instead of spinning up a fresh set of worker goroutines, so
+// callers (the "serve" subcommand) can share one pool across many requests.
+func getNewestTag(image, username, password string, redisClient *redis.Client, selector TagSelector, limiter *registryLimiter, pool *workerPool) (Output, error) {
 	var output Output
 	output.Image = image
 
-	tagList, err := getTagsList(image, username, password)
+	imageParts, err := parseImageName(image)
 	if err != nil {
 		return output, err
 	}
 
-	numJobs := len(tagList.Tags)
-	jobs := make(chan string, numJobs)
-	results := make(chan ImageTag, numJobs)
+	tagList, err := getTagsListLimited(image, username, password, limiter, imageParts.host)
+	if err != nil {
+		return output, err
+	}
 
-	for w := 1; w <= *threads; w++ {
-		go getTagDateUsingCache(image, username, password, redisClient, jobs, results)
+	tagNames, err := filterTagNames(tagList.Tags)
+	if err != nil {
+		return output, err
 	}
 
-	for _, tagName := range tagList.Tags {
-		jobs <- tagName
+	numJobs := len(tagNames)
+	results := make(chan ImageTag, numJobs)
+
+	if pool != nil {
+		for _, tagName := range tagNames {
+			pool.submit(tagJob{
+				image: image,
+				tagName: tagName,
+				username: username,
+				password: password,
+				redisClient: redisClient,
+				limiter: limiter,
+				host: imageParts.host,
+				results: results,
+			})
+		}
+	} else {
+		jobs := make(chan string, numJobs)
+
+		for w := 1; w <= *threads; w++ {
+			go getTagDateUsingCache(image, username, password, redisClient, limiter, imageParts.host, jobs, results)
+		}
+
+		for _, tagName := range tagNames {
+			jobs <- tagName
+		}
+		close(jobs)
 	}
-	close(jobs)
 
 	var tags []ImageTag
+	var skipped []SkippedTag
 	for a := 1; a <= numJobs; a++ {
 		tag := <-results
 		if tag.err != nil {
-			return output, tag.err
+			if statusErr, ok := tag.err.(*httpStatusError); ok && statusErr.statusCode == 401 {
+				return output, fmt.Errorf("aborting, registry rejected request for tag %s: %v", tag.tag, statusErr)
+			}
+
+			if *failOnError {
+				return output, tag.err
+			}
+
+			log.Warnf("Skipping tag %s: %v", tag.tag, tag.err)
+			skipped = append(skipped, SkippedTag{Tag: tag.tag, Reason: tag.err.Error()})
+			continue
 		}
 		tags = append(tags, tag)
 	}
 
-	sort.Slice(tags, func(i, j int) bool {
-	    return tags[i].date.After(tags[j].date)
-	})
+	if len(tags) == 0 {
+		return output, fmt.Errorf("no tag could be resolved, %d tag(s) skipped due to errors", len(skipped))
+	}
 
-	newestTag := selectTagFromConflictingTags(tags)
+	newestTag, err := selector.Select(tags)
+	if err != nil {
+		return output, err
+	}
 
 	output.Tag = newestTag
+	output.Skipped = skipped
 	output.ImageWithTag = image + ":" + newestTag
 	return output, nil
 }
 
-func main() {
-	customFormatter := new(log.TextFormatter)
-	customFormatter.TimestampFormat = logDateLayout
-	log.SetFormatter(customFormatter)
-	customFormatter.FullTimestamp = true
+// resolveCredentials falls back to the local Docker/Podman registry auth config when
+// no credentials were given explicitly on the command line.
+func resolveCredentials(imageRef, cliUsername, cliPassword string) (string, string) {
+	if cliUsername != anonymousCredential || cliPassword != anonymousCredential {
+		return cliUsername, cliPassword
+	}
 
-	kingpin.Version(ver)
-	kingpin.Parse()
+	imageParts, err := parseImageName(imageRef)
+	if err != nil {
+		return cliUsername, cliPassword
+	}
 
-	if *verbose {
-		log.SetLevel(log.DebugLevel)
+	user, pass, err := resolveRegistryCredentials(imageParts.authHost)
+	if err != nil {
+		log.Debugf("Could not resolve registry credentials for %s: %v", imageParts.authHost, err)
+		return cliUsername, cliPassword
 	}
+	if user == "" {
+		return cliUsername, cliPassword
+	}
+
+	log.Debugf("Using credentials for %s found in local registry auth config", imageParts.authHost)
+	return user, pass
+}
 
+func newRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr: *redisHost + ":" + *redisPort,
+		Password: *redisPassword,
+		DB: *redisDB,
+	})
+}
+
+func runResolve() {
 	var registryPassword string
 	if *passwordFile != "" {
 		file, err := ioutil.ReadFile(*passwordFile)
@@ -426,19 +907,20 @@ func main() {
 		registryPassword = *password
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr: *redisHost + ":" + *redisPort,
-		Password: *redisPassword,
-		DB: *redisDB,
-	})
+	resolvedUsername, registryPassword := resolveCredentials(*image, *username, registryPassword)
 
-	output, err := getNewestTag(*image, *username, registryPassword, client)
+	selector, err := newTagSelector()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output, err := getNewestTag(*image, resolvedUsername, registryPassword, newRedisClient(), selector, nil, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	if *jsonOutput {
-		outputJson, _ := json.Marshal(output)
+		outputJson, err := json.Marshal(output)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -448,3 +930,24 @@ func main() {
 		fmt.Println(output.ImageWithTag)
 	}
 }
+
+func main() {
+	customFormatter := new(log.TextFormatter)
+	customFormatter.TimestampFormat = logDateLayout
+	log.SetFormatter(customFormatter)
+	customFormatter.FullTimestamp = true
+
+	kingpin.Version(ver)
+	command := kingpin.Parse()
+
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	switch command {
+	case serveCmd.FullCommand():
+		runServe()
+	default:
+		runResolve()
+	}
+}
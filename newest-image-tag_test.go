@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGetTagsListPagination exercises getTagsList against a fake registry that paginates
+// /v2/<name>/tags/list across multiple pages using RFC 5988 Link headers, verifying that
+// every page is followed and its tags merged into a single result.
+func TestGetTagsListPagination(t *testing.T) {
+	pages := [][]string{
+		{"v1.0.0", "v1.1.0"},
+		{"v1.2.0", "v1.3.0"},
+		{"v2.0.0"},
+	}
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 0
+		if last := r.URL.Query().Get("last"); last != "" {
+			fmt.Sscanf(last, "page%d", &page)
+		}
+
+		if page+1 < len(pages) {
+			next := fmt.Sprintf("%s%s?n=2&last=page%d", server.URL, r.URL.Path, page+1)
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TagList{Name: "test", Tags: pages[page]})
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = origTransport }()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	tagList, err := getTagsList(host+"/test", anonymousCredential, anonymousCredential)
+	if err != nil {
+		t.Fatalf("getTagsList failed: %v", err)
+	}
+
+	var want []string
+	for _, page := range pages {
+		want = append(want, page...)
+	}
+
+	if len(tagList.Tags) != len(want) {
+		t.Fatalf("got %d tags (%v), want %d (%v)", len(tagList.Tags), tagList.Tags, len(want), want)
+	}
+	for i, tag := range want {
+		if tagList.Tags[i] != tag {
+			t.Errorf("tag %d = %q, want %q", i, tagList.Tags[i], tag)
+		}
+	}
+}
+
+// TestNextTagsPage checks Link header parsing in isolation, including the terminal page
+// (no "next" relation) and a relative next URL.
+func TestNextTagsPage(t *testing.T) {
+	cases := []struct {
+		name string
+		link string
+		host string
+		wantURL string
+		wantOK bool
+	}{
+		{
+			name: "absolute next link",
+			link: `<https://registry.example.com/v2/test/tags/list?n=2&last=foo>; rel="next"`,
+			host: "registry.example.com",
+			wantURL: "https://registry.example.com/v2/test/tags/list?n=2&last=foo",
+			wantOK: true,
+		},
+		{
+			name: "relative next link",
+			link: `</v2/test/tags/list?n=2&last=foo>; rel="next"`,
+			host: "registry.example.com",
+			wantURL: "https://registry.example.com/v2/test/tags/list?n=2&last=foo",
+			wantOK: true,
+		},
+		{
+			name: "no link header",
+			link: "",
+			host: "registry.example.com",
+			wantOK: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			headers := http.Header{}
+			if c.link != "" {
+				headers.Set("Link", c.link)
+			}
+
+			next, ok := nextTagsPage(headers, c.host)
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOK)
+			}
+			if ok && next != c.wantURL {
+				t.Errorf("next = %q, want %q", next, c.wantURL)
+			}
+		})
+	}
+}
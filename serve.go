@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "newest_image_tag_requests_total",
+		Help: "Total /newest requests handled, by result.",
+	}, []string{"result"})
+
+	// registryLatency and registryErrorsTotal are deliberately unlabeled: the registry
+	// host is parsed straight out of the caller-supplied "image" query parameter, so a
+	// per-host label would let any client grow these series without bound.
+	registryLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "newest_image_tag_registry_latency_seconds",
+		Help: "Latency of resolving an image's newest tag against the registry.",
+	})
+
+	cacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "newest_image_tag_cache_lookups_total",
+		Help: "In-process (L1) cache lookups, by outcome.",
+	}, []string{"outcome"})
+
+	registryErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "newest_image_tag_registry_errors_total",
+		Help: "Registry errors encountered while resolving a tag.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, registryLatency, cacheLookupsTotal, registryErrorsTotal)
+}
+
+// cacheEntry is what the in-process LRU stores per cache key
+type cacheEntry struct {
+	output Output
+	expiresAt time.Time
+}
+
+// l1Cache is an always-on, in-process LRU cache sitting in front of the optional Redis
+// cache, so repeated requests for the same image inside the TTL window never touch the
+// registry (or Redis) at all.
+type l1Cache struct {
+	mutex sync.Mutex
+	entries *lru.Cache
+	imageKeys map[string]map[string]struct{}
+	ttl time.Duration
+}
+
+func newL1Cache(size int, ttl time.Duration) (*l1Cache, error) {
+	entries, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &l1Cache{entries: entries, imageKeys: make(map[string]map[string]struct{}), ttl: ttl}, nil
+}
+
+func (c *l1Cache) get(key string) (Output, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, ok := c.entries.Get(key)
+	if !ok {
+		cacheLookupsTotal.WithLabelValues("miss").Inc()
+		return Output{}, false
+	}
+
+	entry := value.(cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.entries.Remove(key)
+		cacheLookupsTotal.WithLabelValues("miss").Inc()
+		return Output{}, false
+	}
+
+	cacheLookupsTotal.WithLabelValues("hit").Inc()
+	return entry.output, true
+}
+
+func (c *l1Cache) set(image, key string, output Output) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries.Add(key, cacheEntry{output: output, expiresAt: time.Now().Add(c.ttl)})
+
+	if c.imageKeys[image] == nil {
+		c.imageKeys[image] = make(map[string]struct{})
+	}
+	c.imageKeys[image][key] = struct{}{}
+}
+
+// invalidate drops every cache entry (any strategy/constraint combination) for image
+func (c *l1Cache) invalidate(image string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key := range c.imageKeys[image] {
+		c.entries.Remove(key)
+	}
+	delete(c.imageKeys, image)
+}
+
+// registryLimiter caps concurrent in-flight requests per registry host. It is acquired
+// by each worker around its actual per-tag registry round trip (see processTag), so it
+// bounds real outbound concurrency regardless of how many --threads workers or /newest
+// requests are running, rather than once per handler invocation.
+type registryLimiter struct {
+	mutex sync.Mutex
+	slots map[string]chan struct{}
+	limit int
+}
+
+func newRegistryLimiter(limit int) *registryLimiter {
+	return &registryLimiter{slots: make(map[string]chan struct{}), limit: limit}
+}
+
+func (l *registryLimiter) acquire(host string) func() {
+	l.mutex.Lock()
+	slot, ok := l.slots[host]
+	if !ok {
+		slot = make(chan struct{}, l.limit)
+		l.slots[host] = slot
+	}
+	l.mutex.Unlock()
+
+	slot <- struct{}{}
+	return func() { <-slot }
+}
+
+// server holds the state shared across HTTP API requests: the Redis client, the L1
+// cache, the per-registry concurrency limiter, and the tag-resolving worker pool. The
+// pool and limiter are created once and shared by every request, so --threads and
+// --registry-concurrency bound the server's total and per-host concurrency respectively,
+// rather than being multiplied by the number of concurrent /newest requests.
+type server struct {
+	redisClient *redis.Client
+	cache *l1Cache
+	limiter *registryLimiter
+	pool *workerPool
+}
+
+// buildSelector turns the strategy/constraint request parameters into a TagSelector
+func buildSelector(strategy, constraintExpr string) (TagSelector, error) {
+	switch strategy {
+	case "", "date":
+		return byDateSelector{}, nil
+	case "semver":
+		var constraint *semver.Constraints
+		if constraintExpr != "" {
+			c, err := semver.NewConstraint(constraintExpr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint: %v", err)
+			}
+			constraint = c
+		}
+		return bySemverSelector{prefix: *semverPrefix, constraint: constraint}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q, must be \"date\" or \"semver\"", strategy)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *server) handleNewest(w http.ResponseWriter, r *http.Request) {
+	imageRef := r.URL.Query().Get("image")
+	if imageRef == "" {
+		requestsTotal.WithLabelValues("bad_request").Inc()
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing image parameter"})
+		return
+	}
+
+	strategy := r.URL.Query().Get("strategy")
+	constraint := r.URL.Query().Get("constraint")
+	cacheKey := imageRef + "|" + strategy + "|" + constraint
+
+	if output, ok := s.cache.get(cacheKey); ok {
+		requestsTotal.WithLabelValues("ok").Inc()
+		writeJSON(w, http.StatusOK, output)
+		return
+	}
+
+	selector, err := buildSelector(strategy, constraint)
+	if err != nil {
+		requestsTotal.WithLabelValues("bad_request").Inc()
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if _, err := parseImageName(imageRef); err != nil {
+		requestsTotal.WithLabelValues("bad_request").Inc()
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	registryUsername, registryPassword := resolveCredentials(imageRef, *username, *password)
+
+	start := time.Now()
+	output, err := getNewestTag(imageRef, registryUsername, registryPassword, s.redisClient, selector, s.limiter, s.pool)
+	registryLatency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		registryErrorsTotal.Inc()
+		requestsTotal.WithLabelValues("error").Inc()
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.cache.set(imageRef, cacheKey, output)
+	requestsTotal.WithLabelValues("ok").Inc()
+	writeJSON(w, http.StatusOK, output)
+}
+
+func (s *server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	imageRef := r.URL.Query().Get("image")
+	if imageRef == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing image parameter"})
+		return
+	}
+
+	s.cache.invalidate(imageRef)
+
+	if *cache {
+		keys, err := s.redisClient.Keys(imageRef + ":*").Result()
+		if err != nil {
+			log.Warnf("Cannot list redis keys for %s: %v", imageRef, err)
+		} else if len(keys) > 0 {
+			if err := s.redisClient.Del(keys...).Err(); err != nil {
+				log.Warnf("Cannot delete redis keys for %s: %v", imageRef, err)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "invalidated"})
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+// runServe starts the "serve" subcommand's long-lived HTTP service.
+func runServe() {
+	cache, err := newL1Cache(*serveCacheSize, time.Duration(*serveCacheTTL)*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{
+		redisClient: newRedisClient(),
+		cache: cache,
+		limiter: newRegistryLimiter(*serveRegistryConcurrency),
+		pool: newWorkerPool(*threads),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/newest", s.handleNewest)
+	mux.HandleFunc("/refresh", s.handleRefresh)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Infof("Listening on %s", *serveListenAddress)
+	log.Fatal(http.ListenAndServe(*serveListenAddress, mux))
+}
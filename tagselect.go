@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// TagSelector picks the single "newest" tag out of a set of candidates
+type TagSelector interface {
+	Select(tags []ImageTag) (string, error)
+}
+
+// byDateSelector picks the tag with the newest manifest/config creation date
+type byDateSelector struct{}
+
+func (byDateSelector) Select(tags []ImageTag) (string, error) {
+	if len(tags) == 0 {
+		return "", fmt.Errorf("no tags to select from")
+	}
+
+	sorted := make([]ImageTag, len(tags))
+	copy(sorted, tags)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].date.After(sorted[j].date)
+	})
+
+	return selectTagFromConflictingTags(sorted), nil
+}
+
+// bySemverSelector picks the highest semantic version tag, optionally constrained
+type bySemverSelector struct {
+	prefix string
+	constraint *semver.Constraints
+}
+
+func (s bySemverSelector) Select(tags []ImageTag) (string, error) {
+	type versionedTag struct {
+		tag string
+		version *semver.Version
+	}
+
+	var versioned []versionedTag
+	for _, t := range tags {
+		version, err := semver.NewVersion(strings.TrimPrefix(t.tag, s.prefix))
+		if err != nil {
+			log.Debugf("Skipping tag %s: not a valid semver: %v", t.tag, err)
+			continue
+		}
+
+		if s.constraint != nil && !s.constraint.Check(version) {
+			continue
+		}
+
+		versioned = append(versioned, versionedTag{tag: t.tag, version: version})
+	}
+
+	if len(versioned) == 0 {
+		return "", fmt.Errorf("no tags matched semver parsing/constraint")
+	}
+
+	sort.Slice(versioned, func(i, j int) bool {
+		return versioned[i].version.GreaterThan(versioned[j].version)
+	})
+
+	return versioned[0].tag, nil
+}
+
+// newTagSelector builds the TagSelector requested on the command line
+func newTagSelector() (TagSelector, error) {
+	if !*semverEnabled {
+		return byDateSelector{}, nil
+	}
+
+	var constraint *semver.Constraints
+	if *semverConstraint != "" {
+		c, err := semver.NewConstraint(*semverConstraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --semver-constraint: %v", err)
+		}
+		constraint = c
+	}
+
+	return bySemverSelector{prefix: *semverPrefix, constraint: constraint}, nil
+}
+
+// filterTagNames applies --include-regex/--exclude-regex before any manifest is fetched
+func filterTagNames(tagNames []string) ([]string, error) {
+	var includeRe, excludeRe *regexp.Regexp
+	var err error
+
+	if *includeRegex != "" {
+		includeRe, err = regexp.Compile(*includeRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --include-regex: %v", err)
+		}
+	}
+
+	if *excludeRegex != "" {
+		excludeRe, err = regexp.Compile(*excludeRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude-regex: %v", err)
+		}
+	}
+
+	if includeRe == nil && excludeRe == nil {
+		return tagNames, nil
+	}
+
+	var filtered []string
+	for _, tagName := range tagNames {
+		if includeRe != nil && !includeRe.MatchString(tagName) {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(tagName) {
+			continue
+		}
+		filtered = append(filtered, tagName)
+	}
+
+	return filtered, nil
+}